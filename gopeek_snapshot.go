@@ -0,0 +1,58 @@
+package gopeek
+
+import "github.com/maruel/panicparse/v2/stack"
+
+// Snapshot is an opaque capture of the goroutines that existed at the
+// moment Condition.Snapshot was called. It is consumed by Condition.Since
+// and Diff to find goroutines that were spawned, or that leaked, between
+// two points in a test.
+type Snapshot struct {
+	goroutines []*stack.Goroutine
+	goids      map[int]bool
+}
+
+// Snapshot captures every goroutine that currently exists, ignoring c's
+// filters, for later use with Condition.Since or Diff.
+func (c *Condition) Snapshot() (*Snapshot, error) {
+	gs, err := NewCondition().Eval()
+	if err != nil {
+		return nil, err
+	}
+	goids := make(map[int]bool, len(gs))
+	for _, g := range gs {
+		goids[g.ID] = true
+	}
+	return &Snapshot{goroutines: gs, goids: goids}, nil
+}
+
+// Since adds a FilterByGo filter that returns true only for goroutines that
+// did not exist when snap was taken.
+// It returns Condition itself for method chaining.
+//
+// Combined with EQ(0), Since(snap).EQ(0).Wait(timeout) (or WaitContext) is
+// the idiomatic way to assert that a function does not leak goroutines:
+// wait for every goroutine spawned after snap to have ended.
+func (c *Condition) Since(snap *Snapshot) *Condition {
+	f := func(g *stack.Goroutine) bool {
+		return !snap.goids[g.ID]
+	}
+	c.filters = append(c.filters, FilterByGo(f))
+	return c
+}
+
+// Diff compares two Snapshots and returns the goroutines present in after
+// but not before (added) and those present in before but not after
+// (removed).
+func Diff(before, after *Snapshot) (added, removed []*stack.Goroutine) {
+	for _, g := range after.goroutines {
+		if !before.goids[g.ID] {
+			added = append(added, g)
+		}
+	}
+	for _, g := range before.goroutines {
+		if !after.goids[g.ID] {
+			removed = append(removed, g)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,94 @@
+package gopeek_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cat2neat/gopeek"
+)
+
+func TestSince(t *testing.T) {
+	before, err := gopeek.NewCondition().Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v\n", err)
+	}
+	release := make(chan struct{})
+	go func() {
+		<-release
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// Wait until the goroutine spawned after before shows up.
+	gs, err := gopeek.NewCondition(gopeek.WithFilterSize(2)).
+		Since(before).
+		CreatedBy("gopeek_test.TestSince.*").
+		EQ(1).WaitContext(ctx)
+	close(release)
+	if err != nil {
+		t.Errorf("unexpected error: %+v\n", err)
+	} else if len(gs) != 1 {
+		t.Errorf("# of goroutines expected: 1, actual: %d\n", len(gs))
+	}
+}
+
+func TestSinceEQZero(t *testing.T) {
+	before, err := gopeek.NewCondition().Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v\n", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		close(done)
+	}()
+	<-done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// The idiomatic "this did not leak a goroutine" assertion.
+	gs, err := gopeek.NewCondition().
+		Since(before).
+		CreatedBy("gopeek_test.TestSinceEQZero.*").
+		EQ(0).WaitContext(ctx)
+	if err != nil {
+		t.Errorf("unexpected error: %+v\n", err)
+	} else if len(gs) != 0 {
+		t.Errorf("# of goroutines expected: 0, actual: %d\n", len(gs))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before, err := gopeek.NewCondition().Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v\n", err)
+	}
+	done := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		<-release
+		close(done)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = gopeek.NewCondition(gopeek.WithFilterSize(1)).
+		CreatedBy("gopeek_test.TestDiff.*").
+		GT(0).WaitContext(ctx)
+	if err != nil {
+		close(release)
+		t.Fatalf("unexpected error: %+v\n", err)
+	}
+	after, err := gopeek.NewCondition().Snapshot()
+	close(release)
+	// Wait for the spawned goroutine to actually exit so it doesn't leak
+	// into subsequent tests sharing this process.
+	<-done
+	if err != nil {
+		t.Fatalf("unexpected error: %+v\n", err)
+	}
+	added, removed := gopeek.Diff(before, after)
+	if len(added) == 0 {
+		t.Errorf("expected at least one added goroutine\n")
+	}
+	if len(removed) != 0 {
+		t.Errorf("expected no removed goroutines, actual: %d\n", len(removed))
+	}
+}
@@ -7,24 +7,24 @@ import (
 	"time"
 
 	"github.com/cat2neat/gopeek"
-	"github.com/maruel/panicparse/stack"
+	"github.com/maruel/panicparse/v2/stack"
 )
 
 func TestGoPeek(t *testing.T) {
 	tests := []struct {
-		do       func() ([]stack.Goroutine, error)
+		do       func() ([]*stack.Goroutine, error)
 		expected int
 		err      error
 	}{
 		{
-			do: func() ([]stack.Goroutine, error) {
+			do: func() ([]*stack.Goroutine, error) {
 				return gopeek.NewCondition(gopeek.WithBufSize(256)).
 					FilterByGo(
 						func(g *stack.Goroutine) bool {
 							return true
 						}).
 					FilterByGoes(
-						func(gs []stack.Goroutine) bool {
+						func(gs []*stack.Goroutine) bool {
 							// There should be only 2 goroutines
 							// - main.main (StateWaitingChannel)
 							// - running this test (StateRunning)
@@ -36,7 +36,7 @@ func TestGoPeek(t *testing.T) {
 			expected: 2,
 		},
 		{
-			do: func() ([]stack.Goroutine, error) {
+			do: func() ([]*stack.Goroutine, error) {
 				// Never happen
 				return gopeek.NewCondition(gopeek.WithFilterSize(2)).
 					In(gopeek.StateSysCall, gopeek.StateWaitingIO).
@@ -45,7 +45,7 @@ func TestGoPeek(t *testing.T) {
 			err: gopeek.ErrTimeout,
 		},
 		{
-			do: func() ([]stack.Goroutine, error) {
+			do: func() ([]*stack.Goroutine, error) {
 				cond := sync.NewCond(&sync.Mutex{})
 				for i := 0; i < 3; i++ {
 					go func() {
@@ -57,7 +57,7 @@ func TestGoPeek(t *testing.T) {
 				// Wait until all spawned goroutines blocked due to lock(cond)
 				gs, err := gopeek.NewCondition(gopeek.WithBufSize(4096), gopeek.WithFilterSize(3)).
 					CreatedBy("gopeek_test.TestGoPeek.*").
-					Is(gopeek.StateWaitingLock).
+					Is(gopeek.StateWaitingSyncCond).
 					EQ(3).Wait(time.Second)
 				cond.Broadcast()
 				return gs, err
@@ -65,7 +65,7 @@ func TestGoPeek(t *testing.T) {
 			expected: 3,
 		},
 		{
-			do: func() ([]stack.Goroutine, error) {
+			do: func() ([]*stack.Goroutine, error) {
 				go func() {
 					time.Sleep(time.Second)
 				}()
@@ -87,7 +87,7 @@ func TestGoPeek(t *testing.T) {
 		gs, err := ts.do()
 		if ts.err == nil {
 			if err != nil {
-				t.Errorf("error occurred ts: %#v, err: %+v\n", ts.do, err)
+				t.Errorf("error occurred ts: %+v\n", err)
 			} else if ts.expected != len(gs) {
 				t.Errorf("# of goroutines expected: %d, actual: %d\n", ts.expected, len(gs))
 			}
@@ -116,20 +116,29 @@ func TestState(t *testing.T) {
 		{input: "select", expected: gopeek.StateWaitingSelect},
 		{input: "select (no cases)", expected: gopeek.StateWaitingSelect},
 		{input: "IO wait", expected: gopeek.StateWaitingIO},
-		{input: "semacquire", expected: gopeek.StateWaitingLock},
-		{input: "semarelease", expected: gopeek.StateWaitingLock},
-		{input: "GC sweep wait", expected: gopeek.StateWaitingGCActivity},
+		{input: "semacquire", expected: gopeek.StateWaitingSemacquire},
+		{input: "semarelease", expected: gopeek.StateWaitingSemarelease},
+		{input: "sem: other", expected: gopeek.StateWaitingLock},
+		{input: "sync.Cond.Wait", expected: gopeek.StateWaitingSyncCond},
+		{input: "sync.Mutex.Lock", expected: gopeek.StateWaitingSyncMutex},
+		{input: "sync.RWMutex.RLock", expected: gopeek.StateWaitingSyncRWMutex},
+		{input: "sync.WaitGroup.Wait", expected: gopeek.StateWaitingSyncWaitGroup},
+		{input: "chan send (nil chan)", expected: gopeek.StateWaitingChanSendNil},
+		{input: "chan receive (nil chan)", expected: gopeek.StateWaitingChanReceiveNil},
+		{input: "GC sweep wait", expected: gopeek.StateGCSweepWait},
 		{input: "GC assist wait", expected: gopeek.StateWaitingGCActivity},
-		{input: "force gc (idle)", expected: gopeek.StateWaitingGCActivity},
-		{input: "GC assist marking", expected: gopeek.StateWaitingGCActivity},
+		{input: "force gc (idle)", expected: gopeek.StateForceGCIdle},
+		{input: "GC assist marking", expected: gopeek.StateGCAssistMarking},
 		{input: "garbage collection scan", expected: gopeek.StateWaitingGCActivity},
 		{input: "garbage collection", expected: gopeek.StateWaitingGCActivity},
-		{input: "panicwait", expected: gopeek.StateOther},
-		{input: "stack growth", expected: gopeek.StateOther},
-		{input: "dumping heap", expected: gopeek.StateOther},
-		{input: "trace reader (blocked)", expected: gopeek.StateOther},
-		{input: "finalizer wait", expected: gopeek.StateOther},
-		{input: "timer goroutine (idle)", expected: gopeek.StateOther},
+		{input: "panicwait", expected: gopeek.StatePanicWait},
+		{input: "stack growth", expected: gopeek.StateStackGrowth},
+		{input: "dumping heap", expected: gopeek.StateDumpingHeap},
+		{input: "trace reader (blocked)", expected: gopeek.StateTraceReaderBlocked},
+		{input: "finalizer wait", expected: gopeek.StateFinalizerWait},
+		{input: "timer goroutine (idle)", expected: gopeek.StateTimerGoroutineIdle},
+		{input: "preempted", expected: gopeek.StatePreempted},
+		{input: "debug call", expected: gopeek.StateDebugCall},
 	}
 	for _, ts := range tests {
 		if s := gopeek.NewState(ts.input); s != ts.expected {
@@ -138,6 +147,25 @@ func TestState(t *testing.T) {
 	}
 }
 
+func TestAliasState(t *testing.T) {
+	const reason = "future waitreason introduced by a newer Go release"
+	// AliasState registers into a package-global map, so clear the alias
+	// again once this test is done - otherwise it leaks into any other test
+	// that happens to run afterward in the same process, including a second
+	// run of this one (AliasState(reason, StateOther) clears it; see its
+	// doc comment).
+	t.Cleanup(func() {
+		gopeek.AliasState(reason, gopeek.StateOther)
+	})
+	if s := gopeek.NewState(reason); s != gopeek.StateOther {
+		t.Errorf("expected: %d, actual: %d", int(gopeek.StateOther), int(s))
+	}
+	gopeek.AliasState(reason, gopeek.StateWaitingLock)
+	if s := gopeek.NewState(reason); s != gopeek.StateWaitingLock {
+		t.Errorf("expected: %d, actual: %d", int(gopeek.StateWaitingLock), int(s))
+	}
+}
+
 func BenchmarkState(b *testing.B) {
 	args := []string{"idle", "runnable", "running", "syscall", "waiting", "dead",
 		"enqueue", "copystack", "sleep", "IO wait"}
@@ -0,0 +1,185 @@
+package gopeek
+
+import (
+	"context"
+	"io"
+	"runtime/trace"
+
+	"github.com/maruel/panicparse/v2/stack"
+	xtrace "golang.org/x/exp/trace"
+)
+
+// WaitTrace behaves like Wait but drives itself off a live runtime/trace
+// event stream instead of polling runtime.Stack + stack.ScanSnapshot on
+// every iteration. It starts a trace session piped straight into a parser,
+// keeps a live goid -> waitreason map up to date as EventStateTransition events
+// arrive, and re-evaluates filters each time a goroutine enters the running,
+// runnable, syscall or waiting state; a goroutine ending only drops it from
+// the map and does not trigger a re-evaluation. This avoids the megabyte
+// stack dumps Wait takes on every spin, which matters when the goroutines
+// satisfying the filters are rare among many active ones.
+//
+// Unlike Wait, a match needs at least one goroutine to survive the filters,
+// so a filter chain whose only passing result is empty (e.g. EQ(0)) never
+// ends WaitTrace before ctx does.
+//
+// Because trace events carry a goroutine's id and waitreason but not its
+// full stack or Signature, every filter, CreatedBy included, is evaluated
+// against goroutines whose CreatedByName is "": a CreatedBy filter whose
+// regexp does not match "" rules out every goroutine. The final snapshot is
+// not filtered again. Prefer In/Is/Not/EQ/GT/LT with WaitTrace.
+//
+// ctx cancellation (including a timeout placed on ctx by the caller) stops
+// the trace session and returns ctx.Err(); a context.DeadlineExceeded is
+// reported as ErrTimeout for consistency with Wait.
+func (c *Condition) WaitTrace(ctx context.Context) ([]*stack.Goroutine, error) {
+	pr, pw := io.Pipe()
+	if err := trace.Start(pw); err != nil {
+		pw.Close()
+		return nil, err
+	}
+	stopped := false
+	stop := func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		// Unblock the pipe before trace.Stop(): if readTrace already gave up
+		// on pr (e.g. it hit a parse error past a trace generation
+		// rollover), trace.Stop()'s internal writer can otherwise block
+		// forever trying to flush a final batch nobody is reading anymore.
+		pr.CloseWithError(io.EOF)
+		trace.Stop()
+		pw.Close()
+	}
+	defer stop()
+
+	r, err := xtrace.NewReader(pr)
+	if err != nil {
+		return nil, err
+	}
+
+	matchCh := make(chan []uint64, 1)
+	errCh := make(chan error, 1)
+	go c.readTrace(r, matchCh, errCh)
+
+	select {
+	case ids := <-matchCh:
+		stop()
+		return c.snapshotByIDs(ids)
+	case err := <-errCh:
+		return nil, err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// traceReasonAlias maps a waitreason as reported by
+// StateTransition.Reason to the string runtime.Stack reports for the same
+// block, for the cases where the trace package's reason table disagrees
+// with runtime.Stack's waitReasons. Extend this as more divergences turn
+// up; NewState's own AliasState lets callers paper over ones gopeek
+// doesn't know about yet without a release.
+var traceReasonAlias = map[string]string{
+	"sync.(*Cond).Wait": "sync.Cond.Wait",
+}
+
+// traceReason translates reason, a StateTransition.Reason, into the form
+// NewState expects, via traceReasonAlias, passing it through unchanged if
+// no translation is registered.
+func traceReason(reason string) string {
+	if alias, ok := traceReasonAlias[reason]; ok {
+		return alias
+	}
+	return reason
+}
+
+// readTrace consumes r until a live transition makes c's filters match, then
+// sends the matching goids on matchCh, or sends a parse error on errCh.
+// It returns, without sending, once r is exhausted without ever matching.
+func (c *Condition) readTrace(r *xtrace.Reader, matchCh chan<- []uint64, errCh chan<- error) {
+	live := make(map[uint64]string)
+	for {
+		ev, err := r.ReadEvent()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			errCh <- err
+			return
+		}
+		if ev.Kind() != xtrace.EventStateTransition {
+			continue
+		}
+		st := ev.StateTransition()
+		if st.Resource.Kind != xtrace.ResourceGoroutine {
+			continue
+		}
+		id := uint64(st.Resource.Goroutine())
+		_, to := st.Goroutine()
+		switch to {
+		case xtrace.GoNotExist:
+			delete(live, id)
+			continue
+		case xtrace.GoRunning:
+			live[id] = strRunning
+		case xtrace.GoRunnable:
+			live[id] = strRunnable
+		case xtrace.GoSyscall:
+			live[id] = strSysCall
+		case xtrace.GoWaiting:
+			live[id] = traceReason(st.Reason)
+		default:
+			continue
+		}
+		if ids := c.matchLive(live); ids != nil {
+			matchCh <- ids
+			return
+		}
+	}
+}
+
+// matchLive runs c's filters against a synthetic goroutine list built from
+// live's ids and waitreasons and returns the ids that survive, or nil if the
+// filters rule out the whole set.
+func (c *Condition) matchLive(live map[uint64]string) []uint64 {
+	gs := make([]*stack.Goroutine, 0, len(live))
+	for id, reason := range live {
+		gs = append(gs, &stack.Goroutine{ID: int(id), Signature: stack.Signature{State: reason}})
+	}
+	gs, ok := c.applyFilters(gs)
+	if !ok || len(gs) == 0 {
+		return nil
+	}
+	ids := make([]uint64, 0, len(gs))
+	for _, g := range gs {
+		ids = append(ids, uint64(g.ID))
+	}
+	return ids
+}
+
+// snapshotByIDs takes a single runtime.Stack dump, parses it, and returns
+// only the goroutines whose id is in ids.
+func (c *Condition) snapshotByIDs(ids []uint64) ([]*stack.Goroutine, error) {
+	want := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	snap, err := c.scan()
+	if err != nil {
+		return nil, err
+	}
+	if snap == nil {
+		return nil, nil
+	}
+	out := make([]*stack.Goroutine, 0, len(ids))
+	for _, g := range snap.Goroutines {
+		if want[uint64(g.ID)] {
+			out = append(out, g)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,49 @@
+package gopeek_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cat2neat/gopeek"
+)
+
+func TestWaitTrace(t *testing.T) {
+	cond := sync.NewCond(&sync.Mutex{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			cond.L.Lock()
+			cond.Wait()
+			cond.L.Unlock()
+		}()
+	}
+	// Goroutine state transitions surface on the trace stream only once the
+	// runtime flushes its per-generation trace buffers, which can lag a
+	// plain runtime.Stack poll by close to a second, so give this more
+	// headroom than Wait/WaitContext equivalents need.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	// Wait until all spawned goroutines blocked due to lock(cond)
+	gs, err := gopeek.NewCondition(gopeek.WithFilterSize(1)).
+		Is(gopeek.StateWaitingSyncCond).
+		EQ(3).WaitTrace(ctx)
+	cond.Broadcast()
+	if err != nil {
+		t.Errorf("unexpected error: %+v\n", err)
+	} else if len(gs) != 3 {
+		t.Errorf("# of goroutines expected: 3, actual: %d\n", len(gs))
+	}
+}
+
+func TestWaitTraceTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	// Never happen
+	_, err := gopeek.NewCondition(gopeek.WithFilterSize(1)).
+		In(gopeek.StateSysCall, gopeek.StateWaitingIO).
+		GT(1).WaitTrace(ctx)
+	if err != gopeek.ErrTimeout {
+		t.Errorf("error expected: %+v, actual: %+v\n", gopeek.ErrTimeout, err)
+	}
+}
@@ -0,0 +1,164 @@
+package gopeek
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/maruel/panicparse/v2/stack"
+)
+
+type (
+	// EventKind distinguishes why Watch emitted an Event.
+	EventKind int
+
+	// Event describes a single goroutine's state change observed by Watch.
+	// From is the zero State on an EventCreated event and To is the zero
+	// State on an EventEnded one, since neither has a meaningful value then.
+	Event struct {
+		Goid int
+		From State
+		To   State
+		When time.Time
+		Kind EventKind
+	}
+)
+
+const (
+	// EventTransition means a watched goroutine's State changed between two
+	// successive evaluations.
+	EventTransition EventKind = iota
+	// EventCreated means a goroutine matching c's FilterByGo filters appeared
+	// that was not present in the previous evaluation.
+	EventCreated
+	// EventEnded means a goroutine that was present in the previous
+	// evaluation is no longer present, either because it exited or because
+	// it no longer passes c's FilterByGo filters.
+	EventEnded
+)
+
+// WaitContext behaves like Wait but is cancelled by ctx instead of only by a
+// time.Duration, so a caller can tie a wait to a t.Cleanup or a parent
+// context's deadline. A ctx deadline being exceeded is reported as
+// ErrTimeout for consistency with Wait; any other ctx cancellation reports
+// ctx.Err().
+func (c *Condition) WaitContext(ctx context.Context) ([]*stack.Goroutine, error) {
+	for {
+		gs, err := c.Eval()
+		if err != nil {
+			return nil, err
+		}
+		if c.satisfied(gs) {
+			return gs, nil
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ErrTimeout
+			}
+			return nil, ctx.Err()
+		default:
+		}
+		runtime.Gosched()
+	}
+}
+
+// Watch evaluates c's filters repeatedly and streams an Event on the
+// returned channel for every goroutine whose State changed since the
+// previous evaluation, including goroutines that appeared (EventCreated) or
+// disappeared (EventEnded) between evaluations. The channel is closed once
+// ctx is done.
+//
+// Watch lets test code assert on the *sequence* of state transitions a
+// goroutine goes through ("Running -> WaitingLock -> Running") instead of
+// only on a terminal condition the way Wait/WaitContext does, which is what
+// people currently paper over with time.Sleep cascades.
+//
+// Watch only consults c's FilterByGo/CreatedBy/Is/Not/In filters to decide
+// which goroutines to watch; GT/LT/EQ/FilterByGoes filters describe the
+// whole goroutine set rather than a single goroutine and are ignored here.
+func (c *Condition) Watch(ctx context.Context) (<-chan Event, error) {
+	ch := make(chan Event)
+	go c.watch(ctx, ch)
+	return ch, nil
+}
+
+func (c *Condition) watch(ctx context.Context, ch chan<- Event) {
+	defer close(ch)
+	prev := make(map[int]State)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		snap, err := c.scan()
+		if err != nil {
+			return
+		}
+		var cur map[int]State
+		if snap == nil {
+			cur = make(map[int]State)
+		} else {
+			cur = make(map[int]State, len(snap.Goroutines))
+			for _, g := range c.filterByGo(snap.Goroutines) {
+				cur[g.ID] = NewState(g.State)
+			}
+		}
+		now := time.Now()
+		for id, state := range cur {
+			prevState, existed := prev[id]
+			switch {
+			case !existed:
+				if !c.sendEvent(ctx, ch, Event{Goid: id, To: state, When: now, Kind: EventCreated}) {
+					return
+				}
+			case prevState != state:
+				if !c.sendEvent(ctx, ch, Event{Goid: id, From: prevState, To: state, When: now, Kind: EventTransition}) {
+					return
+				}
+			}
+		}
+		for id, state := range prev {
+			if _, exists := cur[id]; !exists {
+				if !c.sendEvent(ctx, ch, Event{Goid: id, From: state, When: now, Kind: EventEnded}) {
+					return
+				}
+			}
+		}
+		prev = cur
+		runtime.Gosched()
+	}
+}
+
+// sendEvent delivers ev on ch, returning false without sending if ctx is
+// done first.
+func (c *Condition) sendEvent(ctx context.Context, ch chan<- Event, ev Event) bool {
+	select {
+	case ch <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// filterByGo narrows gs using only the FilterByGo filters added to c,
+// ignoring any FilterByGoes filters since those describe the whole
+// goroutine set rather than a single goroutine.
+func (c *Condition) filterByGo(gs []*stack.Goroutine) []*stack.Goroutine {
+	ngs := make([]*stack.Goroutine, 0, len(gs))
+	for _, f := range c.filters {
+		fg, ok := f.(FilterByGo)
+		if !ok {
+			continue
+		}
+		ngs = ngs[:0]
+		for _, g := range gs {
+			if fg(g) {
+				ngs = append(ngs, g)
+			}
+		}
+		gs = ngs
+	}
+	return gs
+}
@@ -0,0 +1,83 @@
+package gopeek_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cat2neat/gopeek"
+)
+
+func TestWaitContext(t *testing.T) {
+	cond := sync.NewCond(&sync.Mutex{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			cond.L.Lock()
+			cond.Wait()
+			cond.L.Unlock()
+		}()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// Wait until both spawned goroutines blocked due to lock(cond)
+	gs, err := gopeek.NewCondition(gopeek.WithFilterSize(2)).
+		CreatedBy("gopeek_test.TestWaitContext.*").
+		Is(gopeek.StateWaitingSyncCond).
+		EQ(2).WaitContext(ctx)
+	cond.Broadcast()
+	if err != nil {
+		t.Errorf("unexpected error: %+v\n", err)
+	} else if len(gs) != 2 {
+		t.Errorf("# of goroutines expected: 2, actual: %d\n", len(gs))
+	}
+}
+
+func TestWaitContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Never happen
+	_, err := gopeek.NewCondition().
+		In(gopeek.StateSysCall, gopeek.StateWaitingIO).
+		GT(1).WaitContext(ctx)
+	if err != context.Canceled {
+		t.Errorf("error expected: %+v, actual: %+v\n", context.Canceled, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	done := make(chan struct{})
+	cond := sync.NewCond(&sync.Mutex{})
+	go func() {
+		cond.L.Lock()
+		cond.Wait()
+		cond.L.Unlock()
+		close(done)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ch, err := gopeek.NewCondition().
+		CreatedBy("gopeek_test.TestWatch.*").
+		Watch(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v\n", err)
+	}
+	var sawWaitingLock, sawEnded bool
+	for ev := range ch {
+		switch {
+		case ev.To == gopeek.StateWaitingSyncCond && !sawWaitingLock:
+			sawWaitingLock = true
+			cond.Broadcast()
+		case ev.Kind == gopeek.EventEnded:
+			sawEnded = true
+			cancel()
+		}
+	}
+	<-done
+	if !sawWaitingLock {
+		t.Errorf("expected to observe a transition into StateWaitingSyncCond\n")
+	}
+	if !sawEnded {
+		t.Errorf("expected to observe the goroutine end\n")
+	}
+}
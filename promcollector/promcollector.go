@@ -0,0 +1,179 @@
+// Package promcollector exports the number of live goroutines broken down
+// by gopeek.State and by the package.Func that created them, as a
+// prometheus.Collector. The created_by breakdown is always reported; there
+// is no option to leave it out.
+//
+// The standard go_goroutines gauge only reports a total count, so it can't
+// express "too many goroutines stuck in StateWaitingLock" or "growth in
+// StateWaitingChannel goroutines created by package X". Collector fills
+// that gap by reusing gopeek's stack-parsing pipeline on every scrape.
+package promcollector
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/cat2neat/gopeek"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// Option configures a Collector.
+	Option func(*Collector)
+
+	// Collector is a prometheus.Collector reporting gopeek_goroutines, a
+	// gauge labelled by state and by created_by; every sample carries both
+	// labels.
+	Collector struct {
+		cond        *gopeek.Condition
+		desc        *prometheus.Desc
+		whitelist   *regexp.Regexp
+		blacklist   *regexp.Regexp
+		sampleEvery uint32
+
+		mu      sync.Mutex
+		scrapes uint32
+		cached  []prometheus.Metric
+	}
+)
+
+var stateNames = map[gopeek.State]string{
+	gopeek.StateIdle:                  "idle",
+	gopeek.StateRunnable:              "runnable",
+	gopeek.StateRunning:               "running",
+	gopeek.StateSysCall:               "syscall",
+	gopeek.StateWaiting:               "waiting",
+	gopeek.StateDead:                  "dead",
+	gopeek.StateEnqueue:               "enqueue",
+	gopeek.StateCopyStack:             "copystack",
+	gopeek.StateSleeping:              "sleeping",
+	gopeek.StateWaitingChannel:        "waiting_channel",
+	gopeek.StateWaitingSelect:         "waiting_select",
+	gopeek.StateWaitingGCActivity:     "waiting_gc_activity",
+	gopeek.StateWaitingIO:             "waiting_io",
+	gopeek.StateWaitingLock:           "waiting_lock",
+	gopeek.StateWaitingChanSendNil:    "waiting_chan_send_nil",
+	gopeek.StateWaitingChanReceiveNil: "waiting_chan_receive_nil",
+	gopeek.StateWaitingSyncCond:       "waiting_sync_cond",
+	gopeek.StateWaitingSemacquire:     "waiting_semacquire",
+	gopeek.StateWaitingSemarelease:    "waiting_semarelease",
+	gopeek.StateWaitingSyncMutex:      "waiting_sync_mutex",
+	gopeek.StateWaitingSyncRWMutex:    "waiting_sync_rwmutex",
+	gopeek.StateWaitingSyncWaitGroup:  "waiting_sync_waitgroup",
+	gopeek.StateFinalizerWait:         "finalizer_wait",
+	gopeek.StatePanicWait:             "panic_wait",
+	gopeek.StateTraceReaderBlocked:    "trace_reader_blocked",
+	gopeek.StateTimerGoroutineIdle:    "timer_goroutine_idle",
+	gopeek.StateForceGCIdle:           "force_gc_idle",
+	gopeek.StateGCSweepWait:           "gc_sweep_wait",
+	gopeek.StateGCAssistMarking:       "gc_assist_marking",
+	gopeek.StateStackGrowth:           "stack_growth",
+	gopeek.StateDumpingHeap:           "dumping_heap",
+	gopeek.StatePreempted:             "preempted",
+	gopeek.StateDebugCall:             "debug_call",
+	gopeek.StateOther:                 "other",
+}
+
+// stateName returns s's metric label value, falling back to "other" for any
+// State stateNames hasn't been taught about yet (e.g. one registered only
+// via gopeek.AliasState).
+func stateName(s gopeek.State) string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return "other"
+}
+
+// WithCreatedByWhitelist returns an Option that only reports goroutines
+// whose gopeek.CreatedByName matches re, to keep the created_by label's
+// cardinality bounded on services with many goroutine call sites. It can be
+// combined with WithCreatedByBlacklist, which then drops matches from what
+// the whitelist lets through.
+func WithCreatedByWhitelist(re *regexp.Regexp) Option {
+	return func(c *Collector) {
+		c.whitelist = re
+	}
+}
+
+// WithCreatedByBlacklist returns an Option that drops goroutines whose
+// gopeek.CreatedByName matches re.
+func WithCreatedByBlacklist(re *regexp.Regexp) Option {
+	return func(c *Collector) {
+		c.blacklist = re
+	}
+}
+
+// WithSampleEvery returns an Option that only walks live goroutines every n
+// calls to Collect, re-reporting the previous scrape's result the other
+// n-1 times. Full stack dumps are expensive, so this bounds how often a
+// busy service pays for one. n <= 1 samples every scrape, the default.
+func WithSampleEvery(n int) Option {
+	return func(c *Collector) {
+		if n > 1 {
+			c.sampleEvery = uint32(n)
+		}
+	}
+}
+
+// New returns a new Collector ready to be registered with a
+// prometheus.Registry.
+func New(opts ...Option) *Collector {
+	c := &Collector{
+		cond: gopeek.NewCondition(),
+		desc: prometheus.NewDesc(
+			"gopeek_goroutines",
+			"Number of live goroutines broken down by gopeek.State.",
+			[]string{"state", "created_by"}, nil,
+		),
+		sampleEvery: 1,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector. It runs gopeek's stack-parsing
+// pipeline, unless WithSampleEvery is in effect and this scrape falls
+// between samples, in which case the previous scrape's metrics are
+// re-reported.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scrapes++
+	if c.cached != nil && (c.scrapes-1)%c.sampleEvery != 0 {
+		for _, m := range c.cached {
+			ch <- m
+		}
+		return
+	}
+	gs, err := c.cond.Eval()
+	if err != nil {
+		return
+	}
+	counts := make(map[[2]string]int, len(gs))
+	for _, g := range gs {
+		createdBy := gopeek.CreatedByName(g)
+		if c.whitelist != nil && !c.whitelist.MatchString(createdBy) {
+			continue
+		}
+		if c.blacklist != nil && c.blacklist.MatchString(createdBy) {
+			continue
+		}
+		counts[[2]string{stateName(gopeek.NewState(g.State)), createdBy}]++
+	}
+	metrics := make([]prometheus.Metric, 0, len(counts))
+	for key, n := range counts {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.desc, prometheus.GaugeValue, float64(n), key[0], key[1]))
+	}
+	c.cached = metrics
+	for _, m := range metrics {
+		ch <- m
+	}
+}
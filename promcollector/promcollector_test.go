@@ -0,0 +1,54 @@
+package promcollector_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cat2neat/gopeek/promcollector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	cond := sync.NewCond(&sync.Mutex{})
+	go func() {
+		cond.L.Lock()
+		cond.Wait()
+		cond.L.Unlock()
+	}()
+	defer cond.Broadcast()
+
+	c := promcollector.New()
+	ch := make(chan prometheus.Metric, 16)
+	c.Collect(ch)
+	close(ch)
+
+	var n int
+	for range ch {
+		n++
+	}
+	if n == 0 {
+		t.Errorf("expected at least one metric to be collected\n")
+	}
+}
+
+func TestCollectorSampleEvery(t *testing.T) {
+	c := promcollector.New(promcollector.WithSampleEvery(2))
+	first := make(chan prometheus.Metric, 16)
+	c.Collect(first)
+	close(first)
+
+	second := make(chan prometheus.Metric, 16)
+	c.Collect(second)
+	close(second)
+
+	var firstN, secondN int
+	for range first {
+		firstN++
+	}
+	for range second {
+		secondN++
+	}
+	if firstN != secondN {
+		t.Errorf("expected the skipped scrape to re-report the cached metrics: first=%d, second=%d\n", firstN, secondN)
+	}
+}